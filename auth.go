@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// authOptions groups the flags used to build the mongo client's credential
+// and TLS configuration.
+type authOptions struct {
+	Username              string
+	Password              string
+	PasswordFile          string
+	AuthSource            string
+	AuthMechanism         string
+	TLS                   bool
+	TLSCAFile             string
+	TLSCertificateKeyFile string
+	TLSInsecure           bool
+}
+
+// resolvePassword returns the password to authenticate with, preferring
+// PasswordFile (or MONGODB_PASSWORD_FILE from the environment) over Password,
+// so that credentials can be mounted as secrets without leaking into argv.
+func (a authOptions) resolvePassword() (string, error) {
+	passwordFile := a.PasswordFile
+	if passwordFile == "" {
+		passwordFile = os.Getenv("MONGODB_PASSWORD_FILE")
+	}
+	if passwordFile == "" {
+		return a.Password, nil
+	}
+	content, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return "", fmt.Errorf("authOptions::resolvePassword: %w", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// apply applies the auth and TLS options on top of the given client options.
+func (a authOptions) apply(clientOpts *options.ClientOptions) error {
+	if a.Username != "" || a.AuthMechanism == "MONGODB-X509" {
+		password, err := a.resolvePassword()
+		if err != nil {
+			return err
+		}
+		authSource := a.AuthSource
+		if a.AuthMechanism == "MONGODB-X509" {
+			// The driver requires AuthSource to be $external for X509, since
+			// the certificate is verified against that virtual database
+			// rather than any user-defined one.
+			authSource = "$external"
+		}
+		clientOpts.SetAuth(options.Credential{
+			AuthMechanism: a.AuthMechanism,
+			AuthSource:    authSource,
+			Username:      a.Username,
+			Password:      password,
+		})
+	}
+	if a.TLS {
+		tlsConfig := &tls.Config{InsecureSkipVerify: a.TLSInsecure}
+		if a.TLSCAFile != "" {
+			pool := x509.NewCertPool()
+			pem, err := os.ReadFile(a.TLSCAFile)
+			if err != nil {
+				return fmt.Errorf("authOptions::apply: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("authOptions::apply: failed to parse %s as a PEM CA bundle", a.TLSCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if a.TLSCertificateKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(a.TLSCertificateKeyFile, a.TLSCertificateKeyFile)
+			if err != nil {
+				return fmt.Errorf("authOptions::apply: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// replica set member state codes, as documented for replSetGetStatus.
+const (
+	MemberStatePrimary   int32 = 1
+	MemberStateSecondary int32 = 2
+)
+
+// healthStatus is the JSON body returned by /healthz and /readyz.
+type healthStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeHealthStatus writes a healthStatus as JSON with the given HTTP status code.
+func writeHealthStatus(w http.ResponseWriter, code int, status healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// ServeHealthz implements the liveness probe: the process is alive and mongo
+// is reachable over TCP.
+func (h *handler) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	client, err := h.acquireClient(r.Context())
+	if err != nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "down", Detail: err.Error()})
+		return
+	}
+	ctx, cancelFunc := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancelFunc()
+	if err := client.Ping(ctx, nil); err != nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "down", Detail: err.Error()})
+		return
+	}
+	writeHealthStatus(w, http.StatusOK, healthStatus{Status: "up"})
+}
+
+// ServeReadyz implements the readiness probe: the node must be PRIMARY, or
+// SECONDARY with optime lag under MaxLagSeconds, and at least
+// MinHealthyMembers members of the set must report health == 1.
+func (h *handler) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	client, err := h.acquireClient(r.Context())
+	if err != nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: err.Error()})
+		return
+	}
+	result, err := getRsStatus(r.Context(), client, h.AdminDb, h.Timeout)
+	if err != nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: err.Error()})
+		return
+	}
+	raw, err := result.Raw()
+	if err != nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: err.Error()})
+		return
+	}
+	var status replSetStatus
+	if err := bson.Unmarshal(raw, &status); err != nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: err.Error()})
+		return
+	}
+
+	var self *replSetMember
+	var primaryOptime time.Time
+	healthyMembers := 0
+	for i := range status.Members {
+		member := &status.Members[i]
+		if member.Self {
+			self = member
+		}
+		if member.State == MemberStatePrimary && member.OptimeDate.After(primaryOptime) {
+			primaryOptime = member.OptimeDate
+		}
+		if member.Health == 1 {
+			healthyMembers++
+		}
+	}
+
+	if self == nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: "self member not found in replSetGetStatus"})
+		return
+	}
+	if healthyMembers < h.MinHealthyMembers {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: "not enough healthy members"})
+		return
+	}
+	if h.PrimaryOnly && self.State != MemberStatePrimary {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: "node is not PRIMARY"})
+		return
+	}
+	if !h.PrimaryOnly && self.State != MemberStatePrimary && self.State != MemberStateSecondary {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: "node is neither PRIMARY nor SECONDARY"})
+		return
+	}
+	if self.State == MemberStateSecondary && !primaryOptime.IsZero() {
+		lag := primaryOptime.Sub(self.OptimeDate).Seconds()
+		if lag > h.MaxLagSeconds {
+			writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Detail: "optime lag exceeds max-lag-seconds"})
+			return
+		}
+	}
+	writeHealthStatus(w, http.StatusOK, healthStatus{Status: "ready"})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NotYetInitializedCode is the mongo error code returned by replSetGetStatus
+// (and replSetGetConfig) before replSetInitiate has ever been run.
+const NotYetInitializedCode int32 = 94
+
+// DefaultInitiateWait is the default deadline to wait for a PRIMARY to be
+// elected after a successful replSetInitiate.
+const DefaultInitiateWait time.Duration = 60 * time.Second
+
+// isNotYetInitialized reports whether err is the "not yet initialized" error
+// mongo returns before the replica set has ever been configured.
+func isNotYetInitialized(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == NotYetInitializedCode
+	}
+	return false
+}
+
+// membersEquivalent reports whether the desired members document describes
+// the same set of hosts, priorities and votes as the live config, ignoring
+// _id assignment and config version.
+func membersEquivalent(currentMembers bson.A, desiredMembers bson.A) bool {
+	if len(currentMembers) != len(desiredMembers) {
+		return false
+	}
+	normalize := func(members bson.A) map[string][2]float64 {
+		out := make(map[string][2]float64, len(members))
+		for _, m := range members {
+			member, ok := m.(bson.M)
+			if !ok {
+				continue
+			}
+			host, _ := member["host"].(string)
+			priority := 1.0
+			if p, ok := member["priority"]; ok {
+				if f, ok := asFloat64(p); ok {
+					priority = f
+				}
+			}
+			votes := 1.0
+			if v, ok := member["votes"]; ok {
+				if f, ok := asFloat64(v); ok {
+					votes = f
+				}
+			}
+			out[host] = [2]float64{priority, votes}
+		}
+		return out
+	}
+	current := normalize(currentMembers)
+	desired := normalize(desiredMembers)
+	if len(current) != len(desired) {
+		return false
+	}
+	for host, want := range desired {
+		got, ok := current[host]
+		if !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// asFloat64 extracts a float64 out of the numeric types bson may decode a field into.
+func asFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// rsInitiateIdempotent issues replSetInitiate if the set has never been
+// initiated, is a no-op returning the current status if it was already
+// initiated with an equivalent configuration, and either fails loudly or
+// (with reconfigOnDiff) reconfigures the set when the live config diverges
+// from the desired document. After a successful initiate, it polls
+// replSetGetStatus with exponential backoff, up to wait, until a PRIMARY is
+// elected, and returns the resulting status.
+func rsInitiateIdempotent(ctx context.Context, client *mongo.Client, admindb string, document []byte, reconfigOnDiff bool, wait time.Duration, timeout time.Duration) (*mongo.SingleResult, error) {
+	var desired bson.M
+	if err := bson.UnmarshalExtJSON(document, true, &desired); err != nil {
+		return nil, fmt.Errorf("rsInitiateIdempotent::unmarshal: %w", err)
+	}
+	desiredMembers, _ := desired["members"].(bson.A)
+
+	current, err := rsGetConfig(ctx, client, admindb, timeout)
+	switch {
+	case err == nil:
+		// Already initiated.
+		currentMembers, _ := current["members"].(bson.A)
+		if membersEquivalent(currentMembers, desiredMembers) {
+			return getRsStatus(ctx, client, admindb, timeout)
+		}
+		if !reconfigOnDiff {
+			return nil, fmt.Errorf("rsInitiateIdempotent: replica set already initiated with a different configuration")
+		}
+		return rsReconfig(ctx, client, admindb, document, false, timeout)
+	case isNotYetInitialized(err):
+		if _, err := rsInitiate(ctx, client, admindb, document, timeout); err != nil {
+			return nil, fmt.Errorf("rsInitiateIdempotent: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("rsInitiateIdempotent: %w", err)
+	}
+
+	return awaitPrimary(ctx, client, admindb, wait, timeout)
+}
+
+// awaitPrimary polls replSetGetStatus with exponential backoff until a member
+// reports PRIMARY state, or wait elapses.
+func awaitPrimary(ctx context.Context, client *mongo.Client, admindb string, wait time.Duration, timeout time.Duration) (*mongo.SingleResult, error) {
+	deadline := time.Now().Add(wait)
+	backoff := 250 * time.Millisecond
+	const maxBackoff = 5 * time.Second
+
+	var lastResult *mongo.SingleResult
+	for {
+		result, err := getRsStatus(ctx, client, admindb, timeout)
+		if err == nil {
+			raw, err := result.Raw()
+			if err != nil {
+				return nil, fmt.Errorf("awaitPrimary: %w", err)
+			}
+			var status replSetStatus
+			if err := bson.Unmarshal(raw, &status); err != nil {
+				return nil, fmt.Errorf("awaitPrimary: %w", err)
+			}
+			for _, member := range status.Members {
+				if member.State == MemberStatePrimary {
+					return result, nil
+				}
+			}
+			lastResult = result
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			if lastResult != nil {
+				return nil, fmt.Errorf("awaitPrimary: no PRIMARY elected within %s", wait)
+			}
+			return nil, fmt.Errorf("awaitPrimary: no PRIMARY elected within %s: %w", wait, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
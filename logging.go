@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultLogFormat string = "text"
+	DefaultLogLevel  string = "info"
+)
+
+// newLogger builds the process-wide structured logger according to the
+// -log-format and -log-level flags.
+func newLogger(format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("newLogger: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch format {
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("newLogger: unknown log format %q, want json or text", format)
+	}
+	return slog.New(h), nil
+}
+
+// fatal logs msg and err at Error level, then exits the process, mirroring
+// the log.Fatal calls this replaces.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// statusRecorder wraps http.ResponseWriter to capture the status code written,
+// so it can be logged after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestLogging wraps next with per-request structured logging: method,
+// path, remote address, duration, status code and an X-Request-Id, honoring
+// one supplied by the client.
+func withRequestLogging(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqId := r.Header.Get("X-Request-Id")
+		if reqId == "" {
+			reqId = primitive.NewObjectID().Hex()
+		}
+		w.Header().Set("X-Request-Id", reqId)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remoteAddr", r.RemoteAddr,
+			"duration", time.Since(start),
+			"status", recorder.status,
+			"requestId", reqId,
+		)
+	})
+}
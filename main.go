@@ -5,7 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"sync"
@@ -17,17 +17,19 @@ import (
 )
 
 const (
-	DefaultPort    int    = 20000
-	TimeoutSeconds int    = 10
-	AdminDbName    string = "admin"
-	DefaultURI     string = "mongodb://localhost:27017"
+	DefaultPort              int     = 20000
+	TimeoutSeconds           int     = 10
+	AdminDbName              string  = "admin"
+	DefaultURI               string  = "mongodb://localhost:27017"
+	DefaultMaxLagSeconds     float64 = 10
+	DefaultMinHealthyMembers int     = 1
 )
 
 // connect to the mongo database.
-func connect(uri string, timeout time.Duration) (*mongo.Client, error) {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+func connect(ctx context.Context, clientOpts *options.ClientOptions, timeout time.Duration) (*mongo.Client, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
 	defer cancelFunc()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -35,15 +37,15 @@ func connect(uri string, timeout time.Duration) (*mongo.Client, error) {
 }
 
 // Disconnect from the mongo database
-func disconnect(client *mongo.Client, timeout time.Duration) error {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+func disconnect(ctx context.Context, client *mongo.Client, timeout time.Duration) error {
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
 	defer cancelFunc()
 	return client.Disconnect(ctx)
 }
 
 // get replication status
-func getRsStatus(client *mongo.Client, admindb string, timeout time.Duration) (*mongo.SingleResult, error) {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+func getRsStatus(ctx context.Context, client *mongo.Client, admindb string, timeout time.Duration) (*mongo.SingleResult, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
 	defer cancelFunc()
 	result := client.Database(admindb).RunCommand(ctx, bson.D{{"replSetGetStatus", 1}})
 	if err := result.Err(); err != nil {
@@ -53,8 +55,8 @@ func getRsStatus(client *mongo.Client, admindb string, timeout time.Duration) (*
 }
 
 // Initiate the replicaset
-func rsInitiate(client *mongo.Client, admindb string, document []byte, timeout time.Duration) (*mongo.SingleResult, error) {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+func rsInitiate(ctx context.Context, client *mongo.Client, admindb string, document []byte, timeout time.Duration) (*mongo.SingleResult, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
 	defer cancelFunc()
 	var command bson.D
 	if err := bson.UnmarshalExtJSON(document, true, &command); err != nil {
@@ -106,39 +108,54 @@ func (e httpError) Code() int {
 	return e.code
 }
 
-// HTTP Request handler
+// HTTP Request handler. Client is a single long-lived, internally pooled
+// *mongo.Client shared by every request; the driver's own pool (tuned via
+// ClientOpts) and reconnection logic make per-request connect/disconnect
+// unnecessary. clientMu only guards the rare swap of Client when the
+// background ping loop rebuilds it after repeated failures; the hot path
+// only ever takes the read lock.
 type handler struct {
-	ClientMutex sync.Mutex
-	Client      *mongo.Client
-	Timeout     time.Duration
-	AdminDb     string
-	URI         string
+	clientMu   sync.RWMutex
+	Client     *mongo.Client
+	Timeout    time.Duration
+	AdminDb    string
+	ClientOpts *options.ClientOptions
+
+	// PrimaryOnly, MaxLagSeconds and MinHealthyMembers tune /readyz semantics.
+	PrimaryOnly       bool
+	MaxLagSeconds     float64
+	MinHealthyMembers int
 }
 
-// Acquire a client connection
-func (h *handler) acquireClient() (*mongo.Client, error) {
-	h.ClientMutex.Lock()
-	defer h.ClientMutex.Unlock()
+// acquireClient returns the shared pooled client.
+func (h *handler) acquireClient(ctx context.Context) (*mongo.Client, error) {
+	h.clientMu.RLock()
+	defer h.clientMu.RUnlock()
 	if h.Client == nil {
-		client, err := connect(h.URI, h.Timeout)
-		if err != nil {
-			return nil, err
-		}
-		h.Client = client
+		return nil, fmt.Errorf("handler: no mongo client configured")
 	}
 	return h.Client, nil
 }
 
-// Release a client connection
-func (h *handler) releaseClient(client *mongo.Client) {
-	h.ClientMutex.Lock()
-	if h.Client == nil || h.Client != client {
-		h.ClientMutex.Unlock()
-	} else {
-		h.Client = nil
-		h.ClientMutex.Unlock()
+// rebuildClient replaces the shared client with a freshly connected one,
+// disconnecting the old one in the background. It's called by runPingLoop
+// after consecutive ping failures, since the driver doesn't rebuild a client
+// whose topology has gone entirely unreachable.
+func (h *handler) rebuildClient(ctx context.Context) error {
+	newClient, err := connect(ctx, h.ClientOpts, h.Timeout)
+	if err != nil {
+		return fmt.Errorf("rebuildClient: %w", err)
 	}
-	disconnect(client, h.Timeout)
+	h.clientMu.Lock()
+	oldClient := h.Client
+	h.Client = newClient
+	h.clientMu.Unlock()
+	go func() {
+		if err := disconnect(context.Background(), oldClient, h.Timeout); err != nil {
+			slog.Warn("failed to disconnect stale mongo client", "error", err)
+		}
+	}()
+	return nil
 }
 
 // writeError writes an error message to the writer
@@ -161,7 +178,7 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 	// Get a client connection
-	client, err := h.acquireClient()
+	client, err := h.acquireClient(r.Context())
 	if err != nil {
 		writeError(w, err, http.StatusInternalServerError)
 		return
@@ -182,16 +199,14 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	n, err := w.Write(result)
 	if err != nil {
-		log.Printf("failed to serve request after %d bytes: %s", n, err)
+		slog.Error("failed to serve response", "bytes", n, "error", err)
 	}
 }
 
 // GET request: return replicaSet status
 func (h *handler) GET(client *mongo.Client, w http.ResponseWriter, r *http.Request) ([]byte, error) {
-	result, err := getRsStatus(client, h.AdminDb, h.Timeout)
+	result, err := getRsStatus(r.Context(), client, h.AdminDb, h.Timeout)
 	if err != nil {
-		// Release client which might be failed
-		h.releaseClient(client)
 		return nil, fmt.Errorf("GET::getRsStatus: %w", err)
 	}
 	return singleResultJson(result)
@@ -200,12 +215,36 @@ func (h *handler) GET(client *mongo.Client, w http.ResponseWriter, r *http.Reque
 // parse flags and return replication status
 func main() {
 	var (
-		timeoutFlag  int
-		adminDbFlag  string
-		uriDbFlag    string
-		initiateFlag string
-		serveFlag    bool
-		portFlag     int
+		timeoutFlag          int
+		adminDbFlag          string
+		uriDbFlag            string
+		initiateFlag         string
+		serveFlag            bool
+		portFlag             int
+		metricsIntervalFlag  time.Duration
+		primaryOnlyFlag      bool
+		maxLagSecondsFlag    float64
+		minHealthyMembers    int
+		reconcileFlag        string
+		forceFlag            bool
+		usernameFlag         string
+		passwordFlag         string
+		passwordFileFlag     string
+		authSourceFlag       string
+		authMechanismFlag    string
+		tlsFlag              bool
+		tlsCAFileFlag        string
+		tlsCertKeyFileFlag   string
+		tlsInsecureFlag      bool
+		waitFlag             time.Duration
+		reconfigOnDiffFlag   bool
+		logFormatFlag        string
+		logLevelFlag         string
+		maxPoolSizeFlag      uint64
+		minPoolSizeFlag      uint64
+		serverSelectionFlag  time.Duration
+		pingIntervalFlag     time.Duration
+		pingFailureThreshold int
 	)
 
 	flag.IntVar(&timeoutFlag, "timeout", TimeoutSeconds, "timeout for calls to mongodb")
@@ -214,13 +253,43 @@ func main() {
 	flag.StringVar(&initiateFlag, "initiate", "", "initiate replicaset")
 	flag.BoolVar(&serveFlag, "serve", false, "run HTTP server")
 	flag.IntVar(&portFlag, "port", DefaultPort, "HTTP port to listen on")
+	flag.DurationVar(&metricsIntervalFlag, "metrics-interval", DefaultMetricsInterval, "polling interval for the /metrics endpoint")
+	flag.BoolVar(&primaryOnlyFlag, "primary-only", false, "/readyz only succeeds when this node is PRIMARY")
+	flag.Float64Var(&maxLagSecondsFlag, "max-lag-seconds", DefaultMaxLagSeconds, "/readyz fails when this node is SECONDARY and its optime lag vs. PRIMARY exceeds this many seconds")
+	flag.IntVar(&minHealthyMembers, "min-healthy-members", DefaultMinHealthyMembers, "/readyz fails when fewer than this many members report healthy")
+	flag.StringVar(&reconcileFlag, "reconcile", "", "reconcile the replicaset to match the given desired members document")
+	flag.BoolVar(&forceFlag, "force", false, "force the reconfiguration when no PRIMARY is reachable")
+	flag.StringVar(&usernameFlag, "username", "", "mongo username")
+	flag.StringVar(&passwordFlag, "password", "", "mongo password")
+	flag.StringVar(&passwordFileFlag, "password-file", "", "path to a file containing the mongo password (also read from MONGODB_PASSWORD_FILE)")
+	flag.StringVar(&authSourceFlag, "authSource", AdminDbName, "database against which credentials are authenticated")
+	flag.StringVar(&authMechanismFlag, "authMechanism", "", "mongo auth mechanism, e.g. SCRAM-SHA-256 or MONGODB-X509")
+	flag.BoolVar(&tlsFlag, "tls", false, "connect to mongo over TLS")
+	flag.StringVar(&tlsCAFileFlag, "tlsCAFile", "", "path to a PEM CA bundle used to verify the mongo server certificate")
+	flag.StringVar(&tlsCertKeyFileFlag, "tlsCertificateKeyFile", "", "path to a PEM file with the client certificate and key, for TLS/x509 auth")
+	flag.BoolVar(&tlsInsecureFlag, "tlsInsecure", false, "skip verification of the mongo server certificate")
+	flag.DurationVar(&waitFlag, "wait", DefaultInitiateWait, "how long to wait for a PRIMARY to be elected after -initiate")
+	flag.BoolVar(&reconfigOnDiffFlag, "reconfig-on-diff", false, "with -initiate, reconfigure the set instead of failing when it's already initiated with a different configuration")
+	flag.StringVar(&logFormatFlag, "log-format", DefaultLogFormat, "log output format: json or text")
+	flag.StringVar(&logLevelFlag, "log-level", DefaultLogLevel, "log level: debug, info, warn or error")
+	flag.Uint64Var(&maxPoolSizeFlag, "max-pool-size", DefaultMaxPoolSize, "maximum size of the mongo connection pool")
+	flag.Uint64Var(&minPoolSizeFlag, "min-pool-size", DefaultMinPoolSize, "minimum size of the mongo connection pool")
+	flag.DurationVar(&serverSelectionFlag, "server-selection-timeout", DefaultServerSelectionTimeout, "mongo server selection timeout")
+	flag.DurationVar(&pingIntervalFlag, "ping-interval", DefaultPingInterval, "interval at which -serve mode pings mongo in the background")
+	flag.IntVar(&pingFailureThreshold, "ping-failure-threshold", DefaultPingFailureThreshold, "consecutive background ping failures before -serve mode rebuilds the mongo client")
 	flag.Parse()
 
+	logger, err := newLogger(logFormatFlag, logLevelFlag)
+	if err != nil {
+		fatal("invalid logging flags", err)
+	}
+	slog.SetDefault(logger)
+
 	if timeoutFlag < 1 || timeoutFlag > 1800 {
-		log.Fatal("allowed timeout values are between 1 and 1800 seconds")
+		fatal("invalid -timeout", fmt.Errorf("allowed timeout values are between 1 and 1800 seconds"))
 	}
 	if adminDbFlag == "" {
-		log.Fatal("admindb name must not be empty")
+		fatal("invalid -admindb", fmt.Errorf("admindb name must not be empty"))
 	}
 	if uriDbFlag == "" {
 		uriDbFlag = os.Getenv("MONGODB_URI")
@@ -229,73 +298,114 @@ func main() {
 		uriDbFlag = DefaultURI
 	}
 	if portFlag <= 1024 || portFlag >= 65536 {
-		log.Fatal("allowed port values are between 1025 and 65535")
+		fatal("invalid -port", fmt.Errorf("allowed port values are between 1025 and 65535"))
 	}
 	timeoutDuration := time.Duration(timeoutFlag) * time.Second
 
+	auth := authOptions{
+		Username:              usernameFlag,
+		Password:              passwordFlag,
+		PasswordFile:          passwordFileFlag,
+		AuthSource:            authSourceFlag,
+		AuthMechanism:         authMechanismFlag,
+		TLS:                   tlsFlag,
+		TLSCAFile:             tlsCAFileFlag,
+		TLSCertificateKeyFile: tlsCertKeyFileFlag,
+		TLSInsecure:           tlsInsecureFlag,
+	}
+	clientOpts := options.Client().ApplyURI(uriDbFlag).
+		SetMaxPoolSize(maxPoolSizeFlag).
+		SetMinPoolSize(minPoolSizeFlag).
+		SetServerSelectionTimeout(serverSelectionFlag)
+	if err := auth.apply(clientOpts); err != nil {
+		fatal("failed to apply mongo connection options", err)
+	}
+
 	// If serveFlag given, just serve HTTP requests
 	if serveFlag {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		defer cancelFunc()
+
+		client, err := connect(ctx, clientOpts, timeoutDuration)
+		if err != nil {
+			fatal("failed to connect to mongo", err)
+		}
+
+		h := &handler{
+			Client:            client,
+			Timeout:           timeoutDuration,
+			AdminDb:           adminDbFlag,
+			ClientOpts:        clientOpts,
+			PrimaryOnly:       primaryOnlyFlag,
+			MaxLagSeconds:     maxLagSecondsFlag,
+			MinHealthyMembers: minHealthyMembers,
+		}
+		go runPingLoop(ctx, h, pingIntervalFlag, timeoutDuration, pingFailureThreshold)
+
+		collector := newMetricsCollector(h, metricsIntervalFlag)
+		go collector.Run(ctx)
+
+		mux := http.NewServeMux()
+		mux.Handle("/", h)
+		mux.HandleFunc("/metrics", collector.ServeMetrics)
+		mux.HandleFunc("/healthz", h.ServeHealthz)
+		mux.HandleFunc("/readyz", h.ServeReadyz)
+		mux.HandleFunc("/reconfig", h.ServeReconfig)
+
 		server := http.Server{
-			Addr: fmt.Sprintf(":%d", portFlag),
-			Handler: &handler{
-				Timeout: timeoutDuration,
-				AdminDb: adminDbFlag,
-				URI:     uriDbFlag,
-			},
+			Addr:         fmt.Sprintf(":%d", portFlag),
+			Handler:      withRequestLogging(logger, mux),
 			ReadTimeout:  3 * timeoutDuration,
 			WriteTimeout: 3 * timeoutDuration,
 			IdleTimeout:  3 * timeoutDuration,
 		}
-		fmt.Printf("Listening at port %d", portFlag)
-		log.Fatal(server.ListenAndServe())
+		slog.Info("listening", "port", portFlag)
+		fatal("HTTP server stopped", server.ListenAndServe())
 	}
 
-	client, err := connect(uriDbFlag, timeoutDuration)
+	bgCtx := context.Background()
+	client, err := connect(bgCtx, clientOpts, timeoutDuration)
 	if err != nil {
-		log.Fatal("failed to connect to mongo: ", err)
+		fatal("failed to connect to mongo", err)
 	}
 	defer func() {
-		ctx, cancelFunc := context.WithTimeout(context.Background(), timeoutDuration)
-		defer cancelFunc()
-		if err := client.Disconnect(ctx); err != nil {
-			log.Fatal("failed to disconnect from mongo: ", err)
+		if err := disconnect(bgCtx, client, timeoutDuration); err != nil {
+			fatal("failed to disconnect from mongo", err)
 		}
 	}()
 	var result *mongo.SingleResult
 
-	if initiateFlag == "" {
-		result, err = getRsStatus(client, adminDbFlag, timeoutDuration)
+	switch {
+	case reconcileFlag != "":
+		// if reconcileFlag != "", reconfigure the replicaSet to match the given document
+		reconcileDoc, err := readDocFlag(reconcileFlag)
+		if err != nil {
+			fatal("failed to read replicaSet config document", err)
+		}
+		result, err = rsReconfig(bgCtx, client, adminDbFlag, reconcileDoc, forceFlag, timeoutDuration)
 		if err != nil {
-			log.Fatal("failed to get replicaSet status: ", err)
+			fatal("failed to reconcile replicaSet", err)
 		}
-	} else {
+	case initiateFlag != "":
 		// if initiateFlag != "", initialize the replicaSet with the given document
-		var reader io.Reader
-		if initiateFlag == "-" {
-			// Read initiation doc from stdin
-			fmt.Fprint(os.Stderr, "reading replicaSet config document from stdin")
-			reader = os.Stdin
-		} else {
-			file, err := os.Open(initiateFlag)
-			if err != nil {
-				log.Fatal("failed to open replicaSet config document: ", err)
-			}
-			defer file.Close()
-			reader = file
+		initiateDoc, err := readDocFlag(initiateFlag)
+		if err != nil {
+			fatal("failed to read replicaSet config document", err)
 		}
-		initiateDoc, err := io.ReadAll(reader)
+		result, err = rsInitiateIdempotent(bgCtx, client, adminDbFlag, initiateDoc, reconfigOnDiffFlag, waitFlag, timeoutDuration)
 		if err != nil {
-			log.Fatal("failed to read replicaSet config document: ", err)
+			fatal("failed to initiate replicaSet", err)
 		}
-		result, err = rsInitiate(client, adminDbFlag, initiateDoc, timeoutDuration)
+	default:
+		result, err = getRsStatus(bgCtx, client, adminDbFlag, timeoutDuration)
 		if err != nil {
-			log.Fatal("failed to initiate replicaSet: ", err)
+			fatal("failed to get replicaSet status", err)
 		}
 	}
 
 	str, err := singleResultJson(result)
 	if err != nil {
-		log.Fatal("failed to produce string result: ", err)
+		fatal("failed to produce string result", err)
 	}
 	fmt.Printf("%s\n", string(str))
 }
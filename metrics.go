@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultMetricsInterval is the default polling interval for the /metrics endpoint.
+const DefaultMetricsInterval time.Duration = 15 * time.Second
+
+// replSetMember mirrors the fields of a single member entry returned by replSetGetStatus
+// that are relevant to the /metrics endpoint.
+type replSetMember struct {
+	Name         string    `bson:"name"`
+	Self         bool      `bson:"self"`
+	Health       float64   `bson:"health"`
+	State        int32     `bson:"state"`
+	OptimeDate   time.Time `bson:"optimeDate"`
+	ElectionDate time.Time `bson:"electionDate"`
+}
+
+// replSetStatus mirrors the fields of replSetGetStatus relevant to the /metrics endpoint.
+type replSetStatus struct {
+	Set     string          `bson:"set"`
+	MyState int32           `bson:"myState"`
+	Term    int64           `bson:"term"`
+	Members []replSetMember `bson:"members"`
+}
+
+// metricsCollector periodically polls replSetGetStatus and caches the result
+// rendered in Prometheus text exposition format, so that concurrent scrapes
+// don't each hit mongo directly.
+type metricsCollector struct {
+	Handler  *handler
+	Interval time.Duration
+
+	mu            sync.Mutex
+	lastText      string
+	lastErr       error
+	lastPolled    time.Time
+	electionCount map[string]int64
+	lastElection  map[string]time.Time
+}
+
+// newMetricsCollector builds a collector bound to the given handler.
+func newMetricsCollector(h *handler, interval time.Duration) *metricsCollector {
+	return &metricsCollector{
+		Handler:       h,
+		Interval:      interval,
+		electionCount: make(map[string]int64),
+		lastElection:  make(map[string]time.Time),
+	}
+}
+
+// Run polls replSetGetStatus every Interval until ctx is cancelled.
+func (c *metricsCollector) Run(ctx context.Context) {
+	c.poll(ctx)
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.poll(ctx)
+		}
+	}
+}
+
+// poll fetches the current replica set status and renders it, caching the result.
+func (c *metricsCollector) poll(ctx context.Context) {
+	client, err := c.Handler.acquireClient(ctx)
+	if err != nil {
+		c.setError(err)
+		return
+	}
+	result, err := getRsStatus(ctx, client, c.Handler.AdminDb, c.Handler.Timeout)
+	if err != nil {
+		c.setError(fmt.Errorf("metricsCollector::poll: %w", err))
+		return
+	}
+	raw, err := result.Raw()
+	if err != nil {
+		c.setError(fmt.Errorf("metricsCollector::poll: %w", err))
+		return
+	}
+	var status replSetStatus
+	if err := bson.Unmarshal(raw, &status); err != nil {
+		c.setError(fmt.Errorf("metricsCollector::poll: %w", err))
+		return
+	}
+	c.setText(c.render(status))
+}
+
+// setError records a failed poll, keeping the previously rendered text around
+// so that scrapes still see the last known state.
+func (c *metricsCollector) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+}
+
+// setText records a successfully rendered poll.
+func (c *metricsCollector) setText(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastText = text
+	c.lastErr = nil
+	c.lastPolled = time.Now()
+}
+
+// memberStateStrings maps the state codes documented for replSetGetStatus to
+// their canonical names.
+var memberStateStrings = map[int32]string{
+	0:  "STARTUP",
+	1:  "PRIMARY",
+	2:  "SECONDARY",
+	3:  "RECOVERING",
+	5:  "STARTUP2",
+	6:  "UNKNOWN",
+	7:  "ARBITER",
+	8:  "DOWN",
+	9:  "ROLLBACK",
+	10: "REMOVED",
+}
+
+// memberStateString converts a replSetGetStatus member state code to its
+// canonical name, or "UNKNOWN" if the code isn't recognized.
+func memberStateString(state int32) string {
+	if s, ok := memberStateStrings[state]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
+
+// render converts a replSetStatus into Prometheus text exposition format,
+// excluding mongors_up: that gauge reflects the freshness of the last poll
+// rather than the contents of any single status document, so ServeMetrics
+// renders it separately from the cached text.
+func (c *metricsCollector) render(status replSetStatus) string {
+	var primaryOptime time.Time
+	for _, member := range status.Members {
+		if member.State == 1 && member.OptimeDate.After(primaryOptime) {
+			primaryOptime = member.OptimeDate
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP mongors_replset_my_state the myState field of replSetGetStatus\n")
+	fmt.Fprintf(&b, "# TYPE mongors_replset_my_state gauge\n")
+	fmt.Fprintf(&b, "mongors_replset_my_state{set=%q} %d\n", status.Set, status.MyState)
+
+	fmt.Fprintf(&b, "# HELP mongors_replset_term the current replication term\n")
+	fmt.Fprintf(&b, "# TYPE mongors_replset_term counter\n")
+	fmt.Fprintf(&b, "mongors_replset_term{set=%q} %d\n", status.Set, status.Term)
+
+	fmt.Fprintf(&b, "# HELP mongors_replset_member_state the state field of a replica set member\n")
+	fmt.Fprintf(&b, "# TYPE mongors_replset_member_state gauge\n")
+	fmt.Fprintf(&b, "# HELP mongors_replset_member_health the health field of a replica set member\n")
+	fmt.Fprintf(&b, "# TYPE mongors_replset_member_health gauge\n")
+	fmt.Fprintf(&b, "# HELP mongors_replset_member_optime_lag_seconds seconds of optime lag vs. the current PRIMARY\n")
+	fmt.Fprintf(&b, "# TYPE mongors_replset_member_optime_lag_seconds gauge\n")
+	fmt.Fprintf(&b, "# HELP mongors_replset_member_elections_total number of elections observed for a member since this process started\n")
+	fmt.Fprintf(&b, "# TYPE mongors_replset_member_elections_total counter\n")
+	for _, member := range status.Members {
+		lag := 0.0
+		if !primaryOptime.IsZero() && !member.OptimeDate.IsZero() {
+			lag = primaryOptime.Sub(member.OptimeDate).Seconds()
+		}
+		stateStr := memberStateString(member.State)
+		fmt.Fprintf(&b, "mongors_replset_member_state{set=%q,name=%q,stateStr=%q} %d\n", status.Set, member.Name, stateStr, member.State)
+		fmt.Fprintf(&b, "mongors_replset_member_health{set=%q,name=%q,stateStr=%q} %g\n", status.Set, member.Name, stateStr, member.Health)
+		fmt.Fprintf(&b, "mongors_replset_member_optime_lag_seconds{set=%q,name=%q,stateStr=%q} %g\n", status.Set, member.Name, stateStr, lag)
+		fmt.Fprintf(&b, "mongors_replset_member_elections_total{set=%q,name=%q,stateStr=%q} %d\n", status.Set, member.Name, stateStr, c.bumpElectionCount(member.Name, member.ElectionDate))
+	}
+	return b.String()
+}
+
+// bumpElectionCount tracks, per member, how many distinct electionDate values
+// have been observed since this process started, and returns the running count.
+func (c *metricsCollector) bumpElectionCount(member string, electionDate time.Time) int64 {
+	if !electionDate.IsZero() && c.lastElection[member] != electionDate {
+		c.lastElection[member] = electionDate
+		c.electionCount[member]++
+	}
+	return c.electionCount[member]
+}
+
+// Text returns the last rendered Prometheus text (empty until a poll has
+// succeeded), the time of the last successful poll, and the error of the
+// most recent poll, nil if it succeeded.
+func (c *metricsCollector) Text() (string, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastText, c.lastPolled, c.lastErr
+}
+
+// ServeMetrics implements the /metrics endpoint.
+func (c *metricsCollector) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	text, polled, err := c.Text()
+	if text == "" {
+		if err == nil {
+			err = fmt.Errorf("no successful replSetGetStatus poll yet")
+		}
+		writeError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	var up int
+	if err == nil {
+		up = 1
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP mongors_up whether the last replSetGetStatus poll succeeded\n")
+	fmt.Fprintf(&b, "# TYPE mongors_up gauge\n")
+	fmt.Fprintf(&b, "mongors_up %d\n", up)
+	b.WriteString(text)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Header().Set("X-Last-Polled", polled.UTC().Format(time.RFC3339))
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	DefaultMaxPoolSize            uint64        = 100
+	DefaultMinPoolSize            uint64        = 0
+	DefaultServerSelectionTimeout time.Duration = 30 * time.Second
+	DefaultPingInterval           time.Duration = 10 * time.Second
+	DefaultPingFailureThreshold   int           = 3
+)
+
+// runPingLoop periodically pings h's client until ctx is cancelled, logging
+// the outcome. After failureThreshold consecutive failures it rebuilds the
+// client from h.ClientOpts: the driver's own monitors retry individual
+// servers, but won't reconnect a client whose topology has gone entirely
+// unreachable (e.g. after a network partition heals with new IPs).
+func runPingLoop(ctx context.Context, h *handler, interval time.Duration, timeout time.Duration, failureThreshold int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	consecutiveFailures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			client, err := h.acquireClient(ctx)
+			if err == nil {
+				pingCtx, cancelFunc := context.WithTimeout(ctx, timeout)
+				err = client.Ping(pingCtx, nil)
+				cancelFunc()
+			}
+			if err != nil {
+				consecutiveFailures++
+				slog.Warn("mongo ping failed", "error", err, "consecutiveFailures", consecutiveFailures)
+				if consecutiveFailures >= failureThreshold {
+					if err := h.rebuildClient(ctx); err != nil {
+						slog.Error("failed to rebuild mongo client", "error", err)
+					} else {
+						slog.Info("rebuilt mongo client after consecutive ping failures", "consecutiveFailures", consecutiveFailures)
+					}
+					consecutiveFailures = 0
+				}
+				continue
+			}
+			consecutiveFailures = 0
+			slog.Debug("mongo ping succeeded")
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// readDocFlag reads a document from path, or from stdin if path is "-".
+func readDocFlag(path string) ([]byte, error) {
+	var reader io.Reader
+	if path == "-" {
+		fmt.Fprint(os.Stderr, "reading replicaSet config document from stdin")
+		reader = os.Stdin
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("readDocFlag::open: %w", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	return io.ReadAll(reader)
+}
+
+// rsGetConfig fetches the live replica set configuration document.
+func rsGetConfig(ctx context.Context, client *mongo.Client, admindb string, timeout time.Duration) (bson.M, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+	result := client.Database(admindb).RunCommand(ctx, bson.D{{"replSetGetConfig", 1}})
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("rsGetConfig::runCommand: %w", err)
+	}
+	var reply bson.M
+	if err := result.Decode(&reply); err != nil {
+		return nil, fmt.Errorf("rsGetConfig::decode: %w", err)
+	}
+	config, ok := reply["config"].(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("rsGetConfig: unexpected config document shape")
+	}
+	return config, nil
+}
+
+// asInt32 extracts an int32 out of the numeric types bson may decode a field into.
+func asInt32(v interface{}) (int32, bool) {
+	switch n := v.(type) {
+	case int32:
+		return n, true
+	case int64:
+		return int32(n), true
+	case float64:
+		return int32(n), true
+	}
+	return 0, false
+}
+
+// rsReconfig computes a new replica set configuration by diffing the desired
+// members document against the live one, preserving the _id of members that
+// already exist (matched by host) and assigning new _ids to added members.
+// Removed members are members present in the live config but absent from the
+// desired one. If the live config already matches the desired members
+// (ignoring _id assignment and config version), rsReconfig is a no-op and
+// returns the current status instead of issuing replSetReconfig. Otherwise
+// the resulting config's version is incremented by one, and the command is
+// issued as replSetReconfig, honoring force for the force-reconfig case.
+func rsReconfig(ctx context.Context, client *mongo.Client, admindb string, document []byte, force bool, timeout time.Duration) (*mongo.SingleResult, error) {
+	var desired bson.M
+	if err := bson.UnmarshalExtJSON(document, true, &desired); err != nil {
+		return nil, fmt.Errorf("rsReconfig::unmarshal: %w", err)
+	}
+	desiredMembers, ok := desired["members"].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("rsReconfig: desired document is missing a members array")
+	}
+
+	current, err := rsGetConfig(ctx, client, admindb, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("rsReconfig: %w", err)
+	}
+	currentMembers, _ := current["members"].(bson.A)
+
+	if membersEquivalent(currentMembers, desiredMembers) {
+		return getRsStatus(ctx, client, admindb, timeout)
+	}
+
+	hostToId := make(map[string]int32, len(currentMembers))
+	var maxId int32 = -1
+	for _, m := range currentMembers {
+		member, ok := m.(bson.M)
+		if !ok {
+			continue
+		}
+		host, _ := member["host"].(string)
+		id, _ := asInt32(member["_id"])
+		hostToId[host] = id
+		if id > maxId {
+			maxId = id
+		}
+	}
+
+	nextId := maxId + 1
+	newMembers := make(bson.A, 0, len(desiredMembers))
+	for _, m := range desiredMembers {
+		member, ok := m.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("rsReconfig: desired member entry is not a document")
+		}
+		host, _ := member["host"].(string)
+		if id, exists := hostToId[host]; exists {
+			member["_id"] = id
+		} else {
+			member["_id"] = nextId
+			nextId++
+		}
+		newMembers = append(newMembers, member)
+	}
+
+	version, _ := asInt32(current["version"])
+	newConfig := bson.M{}
+	for k, v := range current {
+		newConfig[k] = v
+	}
+	newConfig["members"] = newMembers
+	newConfig["version"] = version + 1
+	if settings, ok := desired["settings"]; ok {
+		newConfig["settings"] = settings
+	}
+
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+	command := bson.D{{"replSetReconfig", newConfig}}
+	if force {
+		command = append(command, bson.E{"force", true})
+	}
+	result := client.Database(admindb).RunCommand(ctx, command)
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("rsReconfig::runCommand: %w", err)
+	}
+	return result, nil
+}
+
+// ServeReconfig implements POST /reconfig: the request body is a desired
+// members document, same shape as -initiate, and the live replica set is
+// reconfigured to match it. The "force" query parameter mirrors the -force flag.
+func (h *handler) ServeReconfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, httpError{err: fmt.Errorf("unsupported method %s", r.Method), code: http.StatusMethodNotAllowed}, http.StatusMethodNotAllowed)
+		return
+	}
+	client, err := h.acquireClient(r.Context())
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	document, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, fmt.Errorf("ServeReconfig::read: %w", err), http.StatusBadRequest)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	result, err := rsReconfig(r.Context(), client, h.AdminDb, document, force, h.Timeout)
+	if err != nil {
+		writeError(w, fmt.Errorf("ServeReconfig: %w", err), http.StatusInternalServerError)
+		return
+	}
+	str, err := singleResultJson(result)
+	if err != nil {
+		writeError(w, fmt.Errorf("ServeReconfig: %w", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(str)
+}